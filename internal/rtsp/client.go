@@ -0,0 +1,273 @@
+// Package rtsp pulls H.264 over RTSP into a packets.Queue that Next and the
+// get_mp4_segment DoCommand both read from: Next decodes the newest keyframe
+// to an image.Image, get_mp4_segment drains a window of the queue and muxes
+// it into an fMP4 segment.
+package rtsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/pion/rtp"
+
+	"go.viam.com/rdk/logging"
+
+	"github.com/nicksanford/nickcam/internal/rtsp/mp4"
+	"github.com/nicksanford/nickcam/internal/rtsp/packets"
+)
+
+// queueSize is how many NALUs the ring buffer holds. At ~30fps with a couple
+// NALUs per frame this covers a generous multi-second window for
+// get_mp4_segment without needing to size it off the configured fetch duration.
+const queueSize = 4096
+
+// Client connects to a single H.264 RTSP stream and keeps its packets queued
+// up for Next and get_mp4_segment to consume.
+type Client struct {
+	logger logging.Logger
+	url    string
+
+	rtsp     *gortsplib.Client
+	queue    *packets.Queue
+	timeline *packets.Timeline
+	decoder  *h264Decoder
+	cancel   context.CancelFunc
+
+	mu       sync.Mutex
+	sps, pps []byte
+}
+
+// NewClient returns a Client that has not yet connected; call Start to begin
+// streaming.
+func NewClient(logger logging.Logger, rtspURL string) *Client {
+	return &Client{
+		logger:   logger,
+		url:      rtspURL,
+		queue:    packets.NewQueue(queueSize),
+		timeline: &packets.Timeline{},
+	}
+}
+
+// Start connects to the configured URL, sets up the H.264 track, and begins
+// pushing packets into the queue in the background. The stream's lifetime is
+// its own and is ended only by Close, which closes the RTSP connection: ctx
+// here is just the caller's construction context, which (e.g. a component
+// constructor's) can be cancelled right after Start returns, well before the
+// stream should stop, so it is not used.
+func (c *Client) Start(ctx context.Context) error {
+	_, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("parsing rtsp_url: %w", err)
+	}
+
+	c.rtsp = &gortsplib.Client{}
+	if err := c.rtsp.Start(u.Scheme, u.Host); err != nil {
+		return fmt.Errorf("connecting to %s: %w", c.url, err)
+	}
+
+	desc, _, err := c.rtsp.Describe(u)
+	if err != nil {
+		c.rtsp.Close()
+		return fmt.Errorf("describing %s: %w", c.url, err)
+	}
+
+	media, forma, err := findH264Track(desc)
+	if err != nil {
+		c.rtsp.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.sps = forma.SPS
+	c.pps = forma.PPS
+	c.mu.Unlock()
+
+	decoder, err := newH264Decoder()
+	if err != nil {
+		c.rtsp.Close()
+		return fmt.Errorf("creating h264 decoder: %w", err)
+	}
+	c.decoder = decoder
+
+	rtpDec, err := forma.CreateDecoder()
+	if err != nil {
+		c.rtsp.Close()
+		return fmt.Errorf("creating rtp depacketizer: %w", err)
+	}
+
+	if _, err := c.rtsp.Setup(desc.BaseURL, media, 0, 0); err != nil {
+		c.rtsp.Close()
+		return fmt.Errorf("setting up %s: %w", c.url, err)
+	}
+
+	c.rtsp.OnPacketRTP(media, forma, func(pkt *rtp.Packet) {
+		c.onPacketRTP(rtpDec, pkt)
+	})
+
+	if _, err := c.rtsp.Play(nil); err != nil {
+		c.rtsp.Close()
+		return fmt.Errorf("starting playback of %s: %w", c.url, err)
+	}
+
+	return nil
+}
+
+func findH264Track(desc *description.Session) (*description.Media, *format.H264, error) {
+	for _, media := range desc.Medias {
+		for _, forma := range media.Formats {
+			if h264, ok := forma.(*format.H264); ok {
+				return media, h264, nil
+			}
+		}
+	}
+	return nil, nil, errors.New("no H264 track found in stream")
+}
+
+func (c *Client) onPacketRTP(dec *rtph264.Decoder, pkt *rtp.Packet) {
+	nalus, pts, err := dec.Decode(pkt)
+	if err != nil {
+		return
+	}
+
+	gap, dropped := c.timeline.Observe(pts)
+	if dropped {
+		c.logger.Warnf("rtsp: detected %s gap in %s, dropped frame(s) likely", gap, c.url)
+	}
+
+	for _, nalu := range nalus {
+		typ := naluType(nalu)
+		switch typ {
+		case naluTypeSPS:
+			c.mu.Lock()
+			c.sps = nalu
+			c.mu.Unlock()
+		case naluTypePPS:
+			c.mu.Lock()
+			c.pps = nalu
+			c.mu.Unlock()
+		}
+
+		c.queue.Write(packets.Packet{
+			Data:            nalu,
+			IsKeyFrame:      typ == naluTypeIDR,
+			Time:            pts,
+			CompositionTime: pts,
+			Codec:           "h264",
+		})
+	}
+}
+
+// LatestKeyframe decodes and returns the most recently buffered keyframe as
+// an image.Image, polling until one is available or ctx is done.
+func (c *Client) LatestKeyframe(ctx context.Context) (image.Image, error) {
+	for {
+		if pkt, ok := c.queue.LatestKeyFrame(); ok {
+			c.mu.Lock()
+			sps, pps := c.sps, c.pps
+			c.mu.Unlock()
+
+			if len(sps) > 0 && len(pps) > 0 {
+				img, err := c.decoder.decode(annexB(sps, pps, pkt.Data))
+				if err != nil {
+					return nil, fmt.Errorf("decoding keyframe: %w", err)
+				}
+				if img != nil {
+					return img, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// annexB start-code-delimits and concatenates nalus so ffmpeg's H.264 parser
+// can pick up the parameter sets carried ahead of the picture data.
+func annexB(nalus ...[]byte) []byte {
+	startCode := []byte{0, 0, 0, 1}
+	var out []byte
+	for _, nalu := range nalus {
+		out = append(out, startCode...)
+		out = append(out, nalu...)
+	}
+	return out
+}
+
+// MP4Segment drains roughly the last duration worth of buffered packets and
+// muxes them into a standalone fMP4 segment.
+func (c *Client) MP4Segment(ctx context.Context, duration time.Duration) ([]byte, error) {
+	var pkts []packets.Packet
+	cursor := c.queue.ReadTrailer()
+	end := c.queue.WriteTrailer()
+	for cursor < end {
+		pkt, next, err := c.queue.Read(ctx, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("draining packet queue: %w", err)
+		}
+		cursor = next
+		pkts = append(pkts, pkt)
+	}
+	if len(pkts) == 0 {
+		return nil, errors.New("rtsp: no packets buffered yet")
+	}
+
+	cutoff := pkts[len(pkts)-1].Time - duration
+
+	// mp4.Mux needs to start on a keyframe, so find the newest one at or
+	// before cutoff; if cutoff predates every buffered keyframe, fall back to
+	// the oldest one so the segment is still decodable, just shorter than asked.
+	startIdx := -1
+	for i, pkt := range pkts {
+		if !pkt.IsKeyFrame {
+			continue
+		}
+		if startIdx == -1 {
+			startIdx = i
+		}
+		if pkt.Time <= cutoff {
+			startIdx = i
+		}
+	}
+	if startIdx == -1 {
+		return nil, errors.New("rtsp: no keyframe buffered yet")
+	}
+	windowed := pkts[startIdx:]
+
+	c.mu.Lock()
+	sps, pps := c.sps, c.pps
+	c.mu.Unlock()
+
+	return mp4.Mux(sps, pps, windowed)
+}
+
+// Close stops playback and releases the decoder. It is safe to call more
+// than once.
+func (c *Client) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.queue.Close()
+	if c.decoder != nil {
+		c.decoder.close()
+	}
+	if c.rtsp != nil {
+		c.rtsp.Close()
+	}
+	return nil
+}
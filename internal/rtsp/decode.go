@@ -0,0 +1,91 @@
+//go:build cgo
+
+package rtsp
+
+/*
+#cgo pkg-config: libavcodec libavutil libswscale
+#include <libavcodec/avcodec.h>
+#include <libavutil/imgutils.h>
+#include <libswscale/swscale.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"unsafe"
+)
+
+// h264Decoder wraps a libavcodec H.264 decoder plus the swscale context
+// needed to land decoded frames into a Go-native image.Image.
+type h264Decoder struct {
+	codecCtx *C.AVCodecContext
+	frame    *C.AVFrame
+	swsCtx   *C.struct_SwsContext
+}
+
+func newH264Decoder() (*h264Decoder, error) {
+	codec := C.avcodec_find_decoder(C.AV_CODEC_ID_H264)
+	if codec == nil {
+		return nil, errors.New("h264 decoder unavailable")
+	}
+
+	codecCtx := C.avcodec_alloc_context3(codec)
+	if codecCtx == nil {
+		return nil, errors.New("allocating h264 codec context failed")
+	}
+
+	if C.avcodec_open2(codecCtx, codec, nil) < 0 {
+		C.avcodec_free_context(&codecCtx)
+		return nil, errors.New("opening h264 codec failed")
+	}
+
+	return &h264Decoder{codecCtx: codecCtx, frame: C.av_frame_alloc()}, nil
+}
+
+// decode feeds an Annex-B buffer (one or more start-code-delimited NALUs,
+// e.g. SPS, PPS and a keyframe) through ffmpeg and returns the decoded
+// frame as an RGBA image, or nil if ffmpeg needs more data before it can
+// produce a frame.
+func (d *h264Decoder) decode(nalu []byte) (image.Image, error) {
+	if len(nalu) == 0 {
+		return nil, nil
+	}
+
+	var pkt C.AVPacket
+	pkt.data = (*C.uint8_t)(unsafe.Pointer(&nalu[0]))
+	pkt.size = C.int(len(nalu))
+
+	if C.avcodec_send_packet(d.codecCtx, &pkt) < 0 {
+		return nil, errors.New("sending packet to h264 decoder failed")
+	}
+	if C.avcodec_receive_frame(d.codecCtx, d.frame) < 0 {
+		return nil, nil
+	}
+
+	width, height := int(d.frame.width), int(d.frame.height)
+	d.swsCtx = C.sws_getCachedContext(d.swsCtx,
+		C.int(width), C.int(height), C.int(d.frame.format),
+		C.int(width), C.int(height), C.AV_PIX_FMT_RGBA,
+		C.SWS_BILINEAR, nil, nil, nil)
+	if d.swsCtx == nil {
+		return nil, errors.New("creating rgba conversion context failed")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	dstData := [4]*C.uint8_t{(*C.uint8_t)(unsafe.Pointer(&img.Pix[0]))}
+	dstLinesize := [4]C.int{C.int(img.Stride)}
+
+	C.sws_scale(d.swsCtx, &d.frame.data[0], &d.frame.linesize[0], 0, C.int(height), &dstData[0], &dstLinesize[0])
+
+	return img, nil
+}
+
+func (d *h264Decoder) close() {
+	C.av_frame_free(&d.frame)
+	C.avcodec_free_context(&d.codecCtx)
+	if d.swsCtx != nil {
+		C.sws_freeContext(d.swsCtx)
+		d.swsCtx = nil
+	}
+}
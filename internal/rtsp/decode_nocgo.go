@@ -0,0 +1,22 @@
+//go:build !cgo
+
+package rtsp
+
+import (
+	"errors"
+	"image"
+)
+
+// h264Decoder is a stub used when the module is built without cgo (and so
+// without libavcodec); the rtsp source mode is unavailable in that build.
+type h264Decoder struct{}
+
+func newH264Decoder() (*h264Decoder, error) {
+	return nil, errors.New("rtsp source requires a cgo build with libavcodec available")
+}
+
+func (d *h264Decoder) decode(nalu []byte) (image.Image, error) {
+	return nil, errors.New("rtsp source requires a cgo build with libavcodec available")
+}
+
+func (d *h264Decoder) close() {}
@@ -0,0 +1,291 @@
+// Package mp4 builds minimal fragmented MP4 (fMP4) segments out of a run of
+// H.264 packets, for the get_mp4_segment DoCommand.
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/nicksanford/nickcam/internal/rtsp/packets"
+)
+
+const (
+	timescale  = 90000 // matches the 90kHz RTP clock rate H.264 is carried at
+	videoTrack = 1
+)
+
+// Mux wraps pkts (assumed to be in presentation order, starting on a
+// keyframe) into a standalone fMP4 segment: ftyp, moov, moof, mdat. sps/pps
+// are the parameter sets captured from the stream and are baked into the
+// avcC box moov describes the track with.
+func Mux(sps, pps []byte, pkts []packets.Packet) ([]byte, error) {
+	if len(sps) == 0 || len(pps) == 0 {
+		return nil, errors.New("mp4: missing sps/pps, cannot build avcC")
+	}
+	if len(pkts) == 0 {
+		return nil, errors.New("mp4: no packets to mux")
+	}
+
+	// trun's data_offset is the byte offset from the start of moof to this
+	// segment's first sample in mdat; since it doesn't affect moof's length,
+	// render once to measure it and again with the real value.
+	moofBytes := moof(pkts, 0)
+	dataOffset := len(moofBytes) + 8 // + mdat box header
+	moofBytes = moof(pkts, dataOffset)
+
+	var out bytes.Buffer
+	out.Write(ftyp())
+	out.Write(moov(sps, pps, pkts))
+	out.Write(moofBytes)
+	out.Write(mdat(pkts))
+	return out.Bytes(), nil
+}
+
+func box(boxType string, payload []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(8+len(payload)))
+	b.WriteString(boxType)
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func ftyp() []byte {
+	var b bytes.Buffer
+	b.WriteString("isom")
+	binary.Write(&b, binary.BigEndian, uint32(512))
+	b.WriteString("isom")
+	b.WriteString("iso6")
+	b.WriteString("mp41")
+	return box("ftyp", b.Bytes())
+}
+
+func moov(sps, pps []byte, pkts []packets.Packet) []byte {
+	var mvhd bytes.Buffer
+	binary.Write(&mvhd, binary.BigEndian, uint32(0))          // version/flags
+	binary.Write(&mvhd, binary.BigEndian, uint32(0))          // creation time
+	binary.Write(&mvhd, binary.BigEndian, uint32(0))          // modification time
+	binary.Write(&mvhd, binary.BigEndian, uint32(timescale))  // timescale
+	binary.Write(&mvhd, binary.BigEndian, uint32(0))          // duration, unknown for fMP4
+	binary.Write(&mvhd, binary.BigEndian, uint32(0x00010000)) // rate 1.0
+	binary.Write(&mvhd, binary.BigEndian, uint16(0x0100))     // volume 1.0
+	mvhd.Write(make([]byte, 10))                              // reserved
+	mvhd.Write(identityMatrix())
+	mvhd.Write(make([]byte, 24))                                // pre_defined
+	binary.Write(&mvhd, binary.BigEndian, uint32(videoTrack+1)) // next_track_ID
+
+	var b bytes.Buffer
+	b.Write(box("mvhd", mvhd.Bytes()))
+	b.Write(trak(sps, pps, pkts)) // trak already wraps itself in a "trak" box
+	b.Write(box("mvex", box("trex", trex())))
+	return box("moov", b.Bytes())
+}
+
+func trex() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(0))          // version/flags
+	binary.Write(&b, binary.BigEndian, uint32(videoTrack)) // track_ID
+	binary.Write(&b, binary.BigEndian, uint32(1))          // default_sample_description_index
+	binary.Write(&b, binary.BigEndian, uint32(0))          // default_sample_duration
+	binary.Write(&b, binary.BigEndian, uint32(0))          // default_sample_size
+	binary.Write(&b, binary.BigEndian, uint32(0))          // default_sample_flags
+	return b.Bytes()
+}
+
+func trak(sps, pps []byte, pkts []packets.Packet) []byte {
+	var tkhd bytes.Buffer
+	binary.Write(&tkhd, binary.BigEndian, uint32(0x00000007)) // version/flags: enabled+in movie+in preview
+	binary.Write(&tkhd, binary.BigEndian, uint32(0))          // creation time
+	binary.Write(&tkhd, binary.BigEndian, uint32(0))          // modification time
+	binary.Write(&tkhd, binary.BigEndian, uint32(videoTrack)) // track_ID
+	binary.Write(&tkhd, binary.BigEndian, uint32(0))          // reserved
+	binary.Write(&tkhd, binary.BigEndian, uint32(0))          // duration, unknown for fMP4
+	tkhd.Write(make([]byte, 8))                               // reserved
+	binary.Write(&tkhd, binary.BigEndian, uint16(0))          // layer
+	binary.Write(&tkhd, binary.BigEndian, uint16(0))          // alternate_group
+	binary.Write(&tkhd, binary.BigEndian, uint16(0))          // volume
+	binary.Write(&tkhd, binary.BigEndian, uint16(0))          // reserved
+	tkhd.Write(identityMatrix())
+	binary.Write(&tkhd, binary.BigEndian, uint32(0)) // width, filled in by the consumer from the SPS
+	binary.Write(&tkhd, binary.BigEndian, uint32(0)) // height
+
+	var b bytes.Buffer
+	b.Write(box("tkhd", tkhd.Bytes()))
+	b.Write(mdia(sps, pps)) // mdia already wraps itself in a "mdia" box
+	return box("trak", b.Bytes())
+}
+
+func mdia(sps, pps []byte) []byte {
+	var mdhd bytes.Buffer
+	binary.Write(&mdhd, binary.BigEndian, uint32(0))
+	binary.Write(&mdhd, binary.BigEndian, uint32(0))
+	binary.Write(&mdhd, binary.BigEndian, uint32(0))
+	binary.Write(&mdhd, binary.BigEndian, uint32(timescale))
+	binary.Write(&mdhd, binary.BigEndian, uint32(0))
+	binary.Write(&mdhd, binary.BigEndian, uint16(0x55c4)) // und
+	binary.Write(&mdhd, binary.BigEndian, uint16(0))
+
+	var hdlr bytes.Buffer
+	binary.Write(&hdlr, binary.BigEndian, uint32(0))
+	hdlr.Write(make([]byte, 4)) // pre_defined
+	hdlr.WriteString("vide")
+	hdlr.Write(make([]byte, 12)) // reserved
+	hdlr.WriteString("nickcam\x00")
+
+	var b bytes.Buffer
+	b.Write(box("mdhd", mdhd.Bytes()))
+	b.Write(box("hdlr", hdlr.Bytes()))
+	b.Write(minf(sps, pps)) // minf already wraps itself in a "minf" box
+	return box("mdia", b.Bytes())
+}
+
+func minf(sps, pps []byte) []byte {
+	vmhd := box("vmhd", append([]byte{0, 0, 0, 1}, make([]byte, 8)...))
+	dinf := box("dinf", box("dref", dref()))
+
+	var b bytes.Buffer
+	b.Write(vmhd)
+	b.Write(dinf)
+	b.Write(box("stbl", stbl(sps, pps)))
+	return box("minf", b.Bytes())
+}
+
+func dref() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(0)) // version/flags
+	binary.Write(&b, binary.BigEndian, uint32(1)) // entry_count
+	b.Write(box("url ", []byte{0, 0, 0, 1}))
+	return b.Bytes()
+}
+
+// stbl holds empty sample tables: fMP4 describes actual samples in the moof
+// for each segment instead.
+func stbl(sps, pps []byte) []byte {
+	empty32 := []byte{0, 0, 0, 0, 0, 0, 0, 0}
+
+	var b bytes.Buffer
+	b.Write(box("stsd", stsd(sps, pps)))
+	b.Write(box("stts", empty32))
+	b.Write(box("stsc", empty32))
+	b.Write(box("stsz", append(empty32, 0, 0, 0, 0)))
+	b.Write(box("stco", empty32))
+	return b.Bytes()
+}
+
+func stsd(sps, pps []byte) []byte {
+	var avcC bytes.Buffer
+	avcC.WriteByte(1)      // configurationVersion
+	avcC.WriteByte(sps[1]) // AVCProfileIndication
+	avcC.WriteByte(sps[2]) // profile_compatibility
+	avcC.WriteByte(sps[3]) // AVCLevelIndication
+	avcC.WriteByte(0xff)   // 6 reserved bits + lengthSizeMinusOne=3 (4-byte lengths)
+	avcC.WriteByte(0xe1)   // 3 reserved bits + numOfSequenceParameterSets=1
+	binary.Write(&avcC, binary.BigEndian, uint16(len(sps)))
+	avcC.Write(sps)
+	avcC.WriteByte(1) // numOfPictureParameterSets
+	binary.Write(&avcC, binary.BigEndian, uint16(len(pps)))
+	avcC.Write(pps)
+
+	var avc1 bytes.Buffer
+	avc1.Write(make([]byte, 6))                               // reserved
+	binary.Write(&avc1, binary.BigEndian, uint16(1))          // data_reference_index
+	avc1.Write(make([]byte, 16))                              // pre_defined + reserved
+	binary.Write(&avc1, binary.BigEndian, uint16(0))          // width, see tkhd comment
+	binary.Write(&avc1, binary.BigEndian, uint16(0))          // height
+	binary.Write(&avc1, binary.BigEndian, uint32(0x00480000)) // horizresolution 72dpi
+	binary.Write(&avc1, binary.BigEndian, uint32(0x00480000)) // vertresolution 72dpi
+	binary.Write(&avc1, binary.BigEndian, uint32(0))          // reserved
+	binary.Write(&avc1, binary.BigEndian, uint16(1))          // frame_count
+	avc1.Write(make([]byte, 32))                              // compressorname
+	binary.Write(&avc1, binary.BigEndian, uint16(0x0018))     // depth
+	binary.Write(&avc1, binary.BigEndian, int16(-1))          // pre_defined
+	avc1.Write(box("avcC", avcC.Bytes()))
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(0)) // version/flags
+	binary.Write(&b, binary.BigEndian, uint32(1)) // entry_count
+	b.Write(box("avc1", avc1.Bytes()))
+	return b.Bytes()
+}
+
+func moof(pkts []packets.Packet, dataOffset int) []byte {
+	var mfhd bytes.Buffer
+	binary.Write(&mfhd, binary.BigEndian, uint32(0))
+	binary.Write(&mfhd, binary.BigEndian, uint32(1)) // sequence_number
+
+	var b bytes.Buffer
+	b.Write(box("mfhd", mfhd.Bytes()))
+	b.Write(traf(pkts, dataOffset)) // traf already wraps itself in a "traf" box
+	return box("moof", b.Bytes())
+}
+
+func traf(pkts []packets.Packet, dataOffset int) []byte {
+	var tfhd bytes.Buffer
+	binary.Write(&tfhd, binary.BigEndian, uint32(0x020000)) // default-base-is-moof
+	binary.Write(&tfhd, binary.BigEndian, uint32(videoTrack))
+
+	var tfdt bytes.Buffer
+	binary.Write(&tfdt, binary.BigEndian, uint32(0x01000000)) // version 1: 64-bit base media decode time
+	binary.Write(&tfdt, binary.BigEndian, uint64(pkts[0].Time.Seconds()*timescale))
+
+	var b bytes.Buffer
+	b.Write(box("tfhd", tfhd.Bytes()))
+	b.Write(box("tfdt", tfdt.Bytes()))
+	b.Write(box("trun", trun(pkts, dataOffset)))
+	return box("traf", b.Bytes())
+}
+
+func trun(pkts []packets.Packet, dataOffset int) []byte {
+	const flags = 0x000705 // data-offset, first-sample-flags, sample-duration, sample-size, sample-flags present
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(flags))
+	binary.Write(&b, binary.BigEndian, uint32(len(pkts)))
+	binary.Write(&b, binary.BigEndian, int32(dataOffset))
+	binary.Write(&b, binary.BigEndian, uint32(0x02000000))
+
+	for i, pkt := range pkts {
+		duration := sampleDuration(pkts, i)
+		binary.Write(&b, binary.BigEndian, uint32(duration))
+		binary.Write(&b, binary.BigEndian, uint32(4+len(pkt.Data))) // 4-byte AVCC length prefix
+		if pkt.IsKeyFrame {
+			binary.Write(&b, binary.BigEndian, uint32(0x02000000))
+		} else {
+			binary.Write(&b, binary.BigEndian, uint32(0x01010000))
+		}
+	}
+	return b.Bytes()
+}
+
+func sampleDuration(pkts []packets.Packet, i int) uint32 {
+	if i+1 >= len(pkts) {
+		if i == 0 {
+			return uint32(timescale / 30) // guess a frame duration for a single-packet segment
+		}
+		return uint32((pkts[i].Time - pkts[i-1].Time).Seconds() * timescale)
+	}
+	return uint32((pkts[i+1].Time - pkts[i].Time).Seconds() * timescale)
+}
+
+func mdat(pkts []packets.Packet) []byte {
+	var payload bytes.Buffer
+	for _, pkt := range pkts {
+		binary.Write(&payload, binary.BigEndian, uint32(len(pkt.Data)))
+		payload.Write(pkt.Data)
+	}
+	return box("mdat", payload.Bytes())
+}
+
+func identityMatrix() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(0x00010000))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0x00010000))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, uint32(0x40000000))
+	return b.Bytes()
+}
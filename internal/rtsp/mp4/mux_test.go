@@ -0,0 +1,134 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/nicksanford/nickcam/internal/rtsp/packets"
+)
+
+// childBoxes walks a sequence of concatenated boxes (e.g. the payload of a
+// container box) and returns each child's payload by type.
+func childBoxes(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	out := map[string][]byte{}
+	pos := 0
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			t.Fatalf("truncated box header at offset %d", pos)
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		if size < 8 || pos+size > len(data) {
+			t.Fatalf("box %q at offset %d has invalid size %d", typ, pos, size)
+		}
+		out[typ] = data[pos+8 : pos+size]
+		pos += size
+	}
+	return out
+}
+
+// boxOffset returns the byte offset within data of the top-level box typ.
+func boxOffset(t *testing.T, data []byte, typ string) int {
+	t.Helper()
+	pos := 0
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			t.Fatalf("truncated box header at offset %d", pos)
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if string(data[pos+4:pos+8]) == typ {
+			return pos
+		}
+		pos += size
+	}
+	t.Fatalf("top-level box %q not found", typ)
+	return -1
+}
+
+func TestMuxDataOffsetAndSampleTable(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0x00, 0x1e, 0xab, 0xcd}
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	pkts := []packets.Packet{
+		{Data: []byte{0xaa, 0xbb, 0xcc}, IsKeyFrame: true, Time: 0},
+		{Data: []byte{0xdd, 0xee}, Time: time.Second / 30},
+	}
+
+	out, err := Mux(sps, pps, pkts)
+	if err != nil {
+		t.Fatalf("Mux: %v", err)
+	}
+
+	top := childBoxes(t, out)
+	for _, typ := range []string{"ftyp", "moov", "moof", "mdat"} {
+		if _, ok := top[typ]; !ok {
+			t.Fatalf("top-level box %q missing from muxed output", typ)
+		}
+	}
+
+	// moof's offset within out is needed because trun's data_offset is
+	// relative to the start of moof (tfhd sets default-base-is-moof).
+	moofStart := boxOffset(t, out, "moof")
+	mdatStart := boxOffset(t, out, "mdat")
+
+	traf := childBoxes(t, top["moof"])["traf"]
+	trun := childBoxes(t, traf)["trun"]
+
+	flags := binary.BigEndian.Uint32(trun[0:4])
+	if flags != 0x000705 {
+		t.Fatalf("trun flags = %#x, want 0x000705 (data-offset, first-sample-flags, sample-duration, sample-size, sample-flags)", flags)
+	}
+
+	sampleCount := binary.BigEndian.Uint32(trun[4:8])
+	if int(sampleCount) != len(pkts) {
+		t.Fatalf("trun sample_count = %d, want %d", sampleCount, len(pkts))
+	}
+
+	dataOffset := int32(binary.BigEndian.Uint32(trun[8:12]))
+	wantOffset := mdatStart - moofStart + 8 // + mdat box header, to the start of its payload
+	if int(dataOffset) != wantOffset {
+		t.Fatalf("trun data_offset = %d, want %d (start of mdat's payload, relative to moof)", dataOffset, wantOffset)
+	}
+
+	firstSampleFlags := binary.BigEndian.Uint32(trun[12:16])
+	if firstSampleFlags != 0x02000000 {
+		t.Fatalf("trun first_sample_flags = %#x, want 0x02000000 (sync sample)", firstSampleFlags)
+	}
+
+	mdatPayload := childBoxes(t, out[mdatStart:])["mdat"]
+	sampleOff := 16
+	mdatOff := 0
+	for i, pkt := range pkts {
+		size := binary.BigEndian.Uint32(trun[sampleOff+4 : sampleOff+8])
+		if int(size) != 4+len(pkt.Data) {
+			t.Fatalf("sample %d size = %d, want %d (4-byte AVCC length prefix + data)", i, size, 4+len(pkt.Data))
+		}
+
+		sampleLen := binary.BigEndian.Uint32(mdatPayload[mdatOff : mdatOff+4])
+		if int(sampleLen) != len(pkt.Data) {
+			t.Fatalf("mdat sample %d AVCC length = %d, want %d", i, sampleLen, len(pkt.Data))
+		}
+		gotData := mdatPayload[mdatOff+4 : mdatOff+4+len(pkt.Data)]
+		for j, b := range pkt.Data {
+			if gotData[j] != b {
+				t.Fatalf("mdat sample %d byte %d = %#x, want %#x", i, j, gotData[j], b)
+			}
+		}
+
+		sampleOff += 12
+		mdatOff += 4 + len(pkt.Data)
+	}
+}
+
+func TestMuxRejectsMissingInputs(t *testing.T) {
+	if _, err := Mux(nil, []byte{1}, []packets.Packet{{Data: []byte{1}}}); err == nil {
+		t.Fatal("Mux with no sps did not error")
+	}
+	if _, err := Mux([]byte{1, 2, 3, 4}, nil, []packets.Packet{{Data: []byte{1}}}); err == nil {
+		t.Fatal("Mux with no pps did not error")
+	}
+	if _, err := Mux([]byte{1, 2, 3, 4}, []byte{1}, nil); err == nil {
+		t.Fatal("Mux with no packets did not error")
+	}
+}
@@ -0,0 +1,16 @@
+package rtsp
+
+// NALU types relevant to locating keyframes and parameter sets in the H.264
+// bitstream; see Rec. ITU-T H.264 Table 7-1.
+const (
+	naluTypeSPS = 7
+	naluTypePPS = 8
+	naluTypeIDR = 5
+)
+
+func naluType(nalu []byte) int {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return int(nalu[0] & 0x1f)
+}
@@ -0,0 +1,17 @@
+// Package packets provides a bounded packet queue shared between an RTSP
+// reader goroutine and whatever readers need to drain it (Next, and the
+// get_mp4_segment DoCommand).
+package packets
+
+import "time"
+
+// Packet is a single encoded access unit (typically one H.264 NALU) pulled
+// off the wire, along with enough timing metadata to mux it into an MP4
+// segment or hand it to a decoder.
+type Packet struct {
+	Data            []byte
+	IsKeyFrame      bool
+	Time            time.Duration
+	CompositionTime time.Duration
+	Codec           string
+}
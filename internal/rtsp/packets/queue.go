@@ -0,0 +1,119 @@
+package packets
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned from Read once the queue has been closed and no more
+// packets remain to drain.
+var ErrClosed = errors.New("packets: queue closed")
+
+// Queue is a fixed-size ring buffer of Packets written by a single RTSP
+// reader goroutine and drained by any number of concurrent readers, each
+// tracking their own cursor. Once a reader's cursor falls behind the oldest
+// buffered packet, Read fast-forwards it to ReadTrailer instead of returning
+// stale data.
+type Queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	buf    []Packet
+	head   int // cursor of the next packet Write will land on
+	count  int // number of valid packets currently buffered, <= len(buf)
+	closed bool
+}
+
+// NewQueue allocates a Queue that buffers up to size packets.
+func NewQueue(size int) *Queue {
+	q := &Queue{buf: make([]Packet, size)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Write appends a packet, overwriting the oldest buffered one if full.
+func (q *Queue) Write(p Packet) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.buf[q.head%len(q.buf)] = p
+	q.head++
+	if q.count < len(q.buf) {
+		q.count++
+	}
+	q.cond.Broadcast()
+}
+
+// WriteTrailer returns the cursor of the next packet that will be written,
+// i.e. a reader starting here only sees packets written after this call.
+func (q *Queue) WriteTrailer() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.head
+}
+
+// ReadTrailer returns the cursor of the oldest packet still buffered, i.e.
+// the furthest back a reader can start from without missing data.
+func (q *Queue) ReadTrailer() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.head - q.count
+}
+
+// Read returns the packet at cursor, blocking until it has been written. If
+// cursor has already fallen off the back of the buffer it is fast-forwarded
+// to the oldest packet still available. It returns the packet, the cursor to
+// pass on the next call, and ErrClosed once the queue is closed and fully
+// drained.
+func (q *Queue) Read(ctx context.Context, cursor int) (Packet, int, error) {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for cursor >= q.head && !q.closed && ctx.Err() == nil {
+		q.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return Packet{}, cursor, err
+	}
+	if cursor >= q.head {
+		return Packet{}, cursor, ErrClosed
+	}
+	if oldest := q.head - q.count; cursor < oldest {
+		cursor = oldest
+	}
+
+	p := q.buf[cursor%len(q.buf)]
+	return p, cursor + 1, nil
+}
+
+// LatestKeyFrame scans backwards from the most recently written packet and
+// returns the newest keyframe still buffered, if any.
+func (q *Queue) LatestKeyFrame() (Packet, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	oldest := q.head - q.count
+	for i := q.head - 1; i >= oldest; i-- {
+		if p := q.buf[i%len(q.buf)]; p.IsKeyFrame {
+			return p, true
+		}
+	}
+	return Packet{}, false
+}
+
+// Close unblocks any readers waiting on Read. Subsequent Writes are dropped.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
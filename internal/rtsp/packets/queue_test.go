@@ -0,0 +1,113 @@
+package packets
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueWriteRead(t *testing.T) {
+	q := NewQueue(4)
+
+	cursor := q.WriteTrailer()
+	q.Write(Packet{Data: []byte{1}, IsKeyFrame: true, Time: 0})
+	q.Write(Packet{Data: []byte{2}, Time: time.Millisecond})
+
+	p, next, err := q.Read(context.Background(), cursor)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(p.Data) != "\x01" || !p.IsKeyFrame {
+		t.Fatalf("got packet %+v, want the first keyframe written", p)
+	}
+
+	p, _, err = q.Read(context.Background(), next)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(p.Data) != "\x02" {
+		t.Fatalf("got packet %+v, want the second packet written", p)
+	}
+}
+
+func TestQueueReadFastForwardsStaleCursor(t *testing.T) {
+	q := NewQueue(2)
+
+	cursor := q.WriteTrailer()
+	q.Write(Packet{Data: []byte{1}, IsKeyFrame: true})
+	q.Write(Packet{Data: []byte{2}})
+	q.Write(Packet{Data: []byte{3}}) // overwrites packet 1, cursor now points off the back
+
+	p, _, err := q.Read(context.Background(), cursor)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(p.Data) != "\x02" {
+		t.Fatalf("got packet %+v, want Read to fast-forward to the oldest buffered packet", p)
+	}
+}
+
+func TestQueueReadBlocksUntilWritten(t *testing.T) {
+	q := NewQueue(4)
+	cursor := q.WriteTrailer()
+
+	done := make(chan Packet, 1)
+	go func() {
+		p, _, err := q.Read(context.Background(), cursor)
+		if err != nil {
+			return
+		}
+		done <- p
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Read returned before a packet was written")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.Write(Packet{Data: []byte{9}})
+
+	select {
+	case p := <-done:
+		if string(p.Data) != "\x09" {
+			t.Fatalf("got packet %+v, want the packet written after the blocking Read", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not unblock after Write")
+	}
+}
+
+func TestQueueReadReturnsErrClosedOnceDrained(t *testing.T) {
+	q := NewQueue(4)
+	cursor := q.WriteTrailer()
+	q.Write(Packet{Data: []byte{1}})
+	q.Close()
+
+	_, next, err := q.Read(context.Background(), cursor)
+	if err != nil {
+		t.Fatalf("Read of buffered packet after Close: %v", err)
+	}
+
+	if _, _, err := q.Read(context.Background(), next); err != ErrClosed {
+		t.Fatalf("Read past the end of a closed queue = %v, want ErrClosed", err)
+	}
+}
+
+func TestQueueLatestKeyFrame(t *testing.T) {
+	q := NewQueue(4)
+
+	if _, ok := q.LatestKeyFrame(); ok {
+		t.Fatal("LatestKeyFrame on an empty queue returned ok")
+	}
+
+	q.Write(Packet{Data: []byte{1}, IsKeyFrame: true})
+	q.Write(Packet{Data: []byte{2}})
+	q.Write(Packet{Data: []byte{3}, IsKeyFrame: true})
+	q.Write(Packet{Data: []byte{4}})
+
+	p, ok := q.LatestKeyFrame()
+	if !ok || string(p.Data) != "\x03" {
+		t.Fatalf("LatestKeyFrame = %+v, %v, want the newest keyframe", p, ok)
+	}
+}
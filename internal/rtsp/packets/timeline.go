@@ -0,0 +1,48 @@
+package packets
+
+import (
+	"sync"
+	"time"
+)
+
+// maxFrameGap is the largest gap between consecutive presentation timestamps
+// that Timeline tolerates before flagging a drop.
+const maxFrameGap = 200 * time.Millisecond
+
+// Timeline tracks presentation timestamps across packets written to a Queue
+// and flags any gap larger than maxFrameGap as a likely dropped frame; a
+// pause in the source longer than that is flagged the same way.
+type Timeline struct {
+	mu      sync.Mutex
+	lastPTS time.Duration
+	hasLast bool
+	dropped int
+}
+
+// Observe records pts and reports the gap since the previous observation and
+// whether that gap was large enough to count as a dropped frame.
+func (t *Timeline) Observe(pts time.Duration) (gap time.Duration, dropped bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.hasLast {
+		t.hasLast = true
+		t.lastPTS = pts
+		return 0, false
+	}
+
+	gap = pts - t.lastPTS
+	t.lastPTS = pts
+	if gap > maxFrameGap {
+		t.dropped++
+		return gap, true
+	}
+	return gap, false
+}
+
+// Dropped returns the number of gaps Observe has flagged so far.
+func (t *Timeline) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"math/rand"
 	"os"
 	"slices"
 	"strings"
@@ -19,13 +21,16 @@ import (
 	"golang.org/x/exp/maps"
 
 	"github.com/nicksanford/imageclock/clockdrawer"
+	"github.com/nicksanford/nickcam/internal/rtsp"
 	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
 	"go.viam.com/rdk/gostream"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/module"
 	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/rimage/transform"
+	"go.viam.com/rdk/services/vision"
 )
 
 var (
@@ -52,9 +57,17 @@ var colors = map[string]color.NRGBA{
 
 var colorOptions = maps.Keys(colors)
 
+var sources = map[string]bool{
+	"clock": true,
+	"rtsp":  true,
+}
+
+var sourceOptions = maps.Keys(sources)
+
 func init() {
 	slices.Sort(colorOptions)
 	slices.Sort(imageTypeOptions)
+	slices.Sort(sourceOptions)
 }
 
 var Model = resource.NewModel("ncs", "camera", "nickcam")
@@ -68,16 +81,56 @@ type fake struct {
 	mu sync.Mutex
 	resource.Named
 	resource.AlwaysRebuild
-	resource.TriviallyCloseable
 	clockDrawer *clockdrawer.ClockDrawer
 	big         bool
+	color       string
+	imageType   string
 	logger      logging.Logger
+
+	// cam and vision are only set when the config wires in an actual_cam and
+	// vision_service pair, turning this fake into a detection filter in front
+	// of a real camera.
+	cam     camera.Camera
+	vision  vision.Service
+	objects []string
+
+	// rtsp is only set when source is "rtsp"; it replaces clockDrawer as the
+	// source of frames for Next/Images/Stream.
+	rtsp *rtsp.Client
+
+	// faults holds per-method fault descriptors installed via the "inject"
+	// DoCommand, guarded by mu like the rest of this struct's state.
+	faults map[string]*fault
+}
+
+// fault describes synthetic failure behavior injected on a single method via
+// the "inject" DoCommand.
+type fault struct {
+	Error       string  `json:"error,omitempty"`
+	Probability float64 `json:"probability,omitempty"`
+	LatencyMs   int     `json:"latency_ms,omitempty"`
+	DropEveryN  int     `json:"drop_every_n,omitempty"`
+	Corrupt     bool    `json:"corrupt,omitempty"`
+
+	calls int
 }
 
 type Config struct {
 	Big       bool   `json:"big,omitempty"`
 	Color     string `json:"color,omitempty"`
 	ImageType string `json:"image_type,omitempty"`
+
+	// ActualCam and VisionService, when both set, cause Images/Stream/Next to
+	// filter frames pulled from ActualCam through VisionService and only
+	// return ones where one of Objects was detected.
+	ActualCam     string   `json:"actual_cam,omitempty"`
+	VisionService string   `json:"vision_service,omitempty"`
+	Objects       []string `json:"objects,omitempty"`
+
+	// Source selects where frames come from: "clock" (default) draws a
+	// clock face, "rtsp" pulls H.264 from RTSPURL.
+	Source  string `json:"source,omitempty"`
+	RTSPURL string `json:"rtsp_url,omitempty"`
 }
 
 func (c *Config) Validate(path string) ([]string, error) {
@@ -90,17 +143,68 @@ func (c *Config) Validate(path string) ([]string, error) {
 		return nil, fmt.Errorf("config image_type %s invalid, valid image types: %s", c.ImageType, strings.Join(imageTypeOptions, ", "))
 	}
 
-	return nil, nil
+	if (c.ActualCam == "") != (c.VisionService == "") {
+		return nil, errors.New("actual_cam and vision_service must both be set to enable detection filtering")
+	}
+
+	if c.ActualCam != "" && len(c.Objects) == 0 {
+		return nil, errors.New("objects must be non-empty when actual_cam and vision_service are configured")
+	}
+
+	source := c.Source
+	if source == "" {
+		source = "clock"
+	}
+	if !sources[source] {
+		return nil, fmt.Errorf("config source %s invalid, valid sources: %s", c.Source, strings.Join(sourceOptions, ", "))
+	}
+	if source == "rtsp" && c.RTSPURL == "" {
+		return nil, errors.New("rtsp_url must be set when source is rtsp")
+	}
+
+	var deps []string
+	if c.ActualCam != "" {
+		deps = append(deps, c.ActualCam)
+	}
+	if c.VisionService != "" {
+		deps = append(deps, c.VisionService)
+	}
+
+	return deps, nil
 }
 
 type s struct {
 	clockDrawer *clockdrawer.ClockDrawer
 	logger      logging.Logger
+	cam         camera.Camera
+	vision      vision.Service
+	objects     []string
+	rtsp        *rtsp.Client
+	faultCheck  func(ctx context.Context, method string) error
 }
 
 func (s *s) Next(ctx context.Context) (image.Image, func(), error) {
 	s.logger.Debug("GetImage (NEXT) START")
 	defer s.logger.Debug("GetImage (NEXT) END")
+	if s.faultCheck != nil {
+		if err := s.faultCheck(ctx, "Next"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if s.rtsp != nil {
+		img, err := s.rtsp.LatestKeyframe(ctx)
+		return img, nil, err
+	}
+	if s.cam != nil {
+		img, matched, err := detectFilteredImage(ctx, s.cam, s.vision, s.objects)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !matched {
+			return nil, nil, data.ErrNoCaptureToStore
+		}
+		return img, nil, nil
+	}
 	img, err := s.clockDrawer.Image("image time: " + time.Now().Format(time.RFC3339Nano))
 	return img, nil, err
 }
@@ -110,7 +214,40 @@ func (s *s) Close(ctx context.Context) error {
 }
 
 func (f *fake) newStream() gostream.MediaStream[image.Image] {
-	return &s{clockDrawer: f.clockDrawer, logger: f.logger}
+	return &s{
+		clockDrawer: f.clockDrawer,
+		logger:      f.logger,
+		cam:         f.cam,
+		vision:      f.vision,
+		objects:     f.objects,
+		rtsp:        f.rtsp,
+		faultCheck:  f.checkFault,
+	}
+}
+
+// detectFilteredImage pulls a frame from cam and runs it through vis, returning
+// the frame and matched=true if any detection's label is in objects.
+func detectFilteredImage(ctx context.Context, cam camera.Camera, vis vision.Service, objects []string) (image.Image, bool, error) {
+	img, release, err := camera.ReadImage(ctx, cam)
+	if release != nil {
+		defer release()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	dets, err := vis.Detections(ctx, img, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, d := range dets {
+		if slices.Contains(objects, d.Label()) {
+			return img, true, nil
+		}
+	}
+
+	return nil, false, nil
 }
 
 func newCam(
@@ -129,19 +266,87 @@ func newCam(
 		return nil, err
 	}
 
-	return &fake{
+	f := &fake{
 		Named:       named,
 		big:         c.Big,
+		color:       c.Color,
+		imageType:   c.ImageType,
 		logger:      logger,
 		clockDrawer: &cd,
-	}, nil
+		objects:     c.Objects,
+	}
+
+	if c.ActualCam != "" {
+		cam, err := camera.FromDependencies(deps, c.ActualCam)
+		if err != nil {
+			return nil, err
+		}
+		vis, err := vision.FromDependencies(deps, c.VisionService)
+		if err != nil {
+			return nil, err
+		}
+		f.cam = cam
+		f.vision = vis
+	}
+
+	if c.Source == "rtsp" {
+		client := rtsp.NewClient(logger, c.RTSPURL)
+		if err := client.Start(ctx); err != nil {
+			return nil, fmt.Errorf("starting rtsp client: %w", err)
+		}
+		f.rtsp = client
+	}
+
+	return f, nil
 }
 
 func (f *fake) Images(ctx context.Context) ([]camera.NamedImage, resource.ResponseMetadata, error) {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.logger.Debug("GetImages START")
 	defer f.logger.Debug("GetImages END")
+
+	if err := f.maybeFault(ctx, "Images"); err != nil {
+		f.mu.Unlock()
+		return nil, resource.ResponseMetadata{}, err
+	}
+
+	// rtsp/cam branches release f.mu before the blocking downstream call
+	// (RTSP decode or actual_cam+vision RPCs) so other methods, in particular
+	// get_mp4_segment draining the same queue, aren't stalled behind it.
+	if f.rtsp != nil {
+		rtsp, cd := f.rtsp, f.clockDrawer
+		f.mu.Unlock()
+		img, err := rtsp.LatestKeyframe(ctx)
+		if err != nil {
+			return nil, resource.ResponseMetadata{}, err
+		}
+		ts := time.Now()
+		return []camera.NamedImage{
+			{Image: img, SourceName: ts.Format(time.RFC3339Nano) + cd.Ext()},
+		}, resource.ResponseMetadata{CapturedAt: ts}, nil
+	}
+
+	if f.cam != nil {
+		// actual_cam/vision_service are wired once at construction and never
+		// mutated, so it's safe to read them and release f.mu before the
+		// downstream ReadImage/Detections RPCs, which can be slow.
+		cam, vis, objects, cd := f.cam, f.vision, f.objects, f.clockDrawer
+		f.mu.Unlock()
+		img, matched, err := detectFilteredImage(ctx, cam, vis, objects)
+		if err != nil {
+			return nil, resource.ResponseMetadata{}, err
+		}
+		if !matched {
+			return nil, resource.ResponseMetadata{}, data.ErrNoCaptureToStore
+		}
+		ts := time.Now()
+		return []camera.NamedImage{
+			{Image: img, SourceName: ts.Format(time.RFC3339Nano) + cd.Ext()},
+		}, resource.ResponseMetadata{CapturedAt: ts}, nil
+	}
+
+	defer f.mu.Unlock()
+
 	ts1 := time.Now()
 	nowStr1 := ts1.Format(time.RFC3339Nano)
 	img1, err := f.clockDrawer.Image("images1 time: " + nowStr1)
@@ -167,10 +372,23 @@ func (f *fake) NextPointCloud(ctx context.Context) (pointcloud.PointCloud, error
 	defer f.mu.Unlock()
 	f.logger.Debug("NextPointCloud START")
 	defer f.logger.Debug("NextPointCloud END")
+
+	corrupt := false
+	if flt, ok := f.faults["NextPointCloud"]; ok {
+		corrupt = flt.Corrupt
+	}
+	if err := f.maybeFault(ctx, "NextPointCloud"); err != nil {
+		return nil, err
+	}
+
+	pcdBytes := smallPCDBytes
 	if f.big {
-		return pointcloud.ReadPCD(bytes.NewReader(bigPCDBytes))
+		pcdBytes = bigPCDBytes
 	}
-	return pointcloud.ReadPCD(bytes.NewReader(smallPCDBytes))
+	if corrupt {
+		pcdBytes = pcdBytes[:len(pcdBytes)/2]
+	}
+	return pointcloud.ReadPCD(bytes.NewReader(pcdBytes))
 }
 
 func (f *fake) Projector(ctx context.Context) (transform.Projector, error) {
@@ -190,6 +408,11 @@ func (f *fake) Stream(ctx context.Context, eh ...gostream.ErrorHandler) (gostrea
 	defer f.mu.Unlock()
 	f.logger.Debug("Stream START")
 	defer f.logger.Debug("Stream END")
+
+	if err := f.maybeFault(ctx, "Stream"); err != nil {
+		return nil, err
+	}
+
 	return f.newStream(), nil
 }
 
@@ -201,9 +424,247 @@ func (f *fake) DoCommand(ctx context.Context, extra map[string]interface{}) (map
 		f.logger.Info(Cyan + "Boom" + Reset)
 		os.Exit(1)
 	}
+
+	if raw, ok := extra["get_mp4_segment"]; ok {
+		return f.getMP4Segment(ctx, raw)
+	}
+
+	if raw, ok := extra["set_color"]; ok {
+		if err := f.setColor(raw); err != nil {
+			return nil, err
+		}
+		return f.configMap(), nil
+	}
+	if raw, ok := extra["set_image_type"]; ok {
+		if err := f.setImageType(raw); err != nil {
+			return nil, err
+		}
+		return f.configMap(), nil
+	}
+	if raw, ok := extra["set_big"]; ok {
+		if err := f.setBig(raw); err != nil {
+			return nil, err
+		}
+		return f.configMap(), nil
+	}
+	if _, ok := extra["get_config"]; ok {
+		return f.configMap(), nil
+	}
+
+	if raw, ok := extra["inject"]; ok {
+		if err := f.injectFault(raw); err != nil {
+			return nil, err
+		}
+		return f.listFaults(), nil
+	}
+	if raw, ok := extra["clear"]; ok {
+		f.clearFault(raw)
+		return f.listFaults(), nil
+	}
+	if _, ok := extra["list"]; ok {
+		return f.listFaults(), nil
+	}
+
 	return nil, nil
 }
 
+// setColor, setImageType and setBig validate and apply a live config change,
+// rebuilding clockDrawer to match. f.mu must already be held by the caller.
+
+func (f *fake) setColor(raw interface{}) error {
+	color, ok := raw.(string)
+	if !ok {
+		return errors.New("set_color requires a string value")
+	}
+	if _, ok := colors[color]; !ok {
+		return fmt.Errorf("config color %s invalid, valid colors: %s", color, strings.Join(colorOptions, ", "))
+	}
+	f.logger.Infof("nickcam: color %s -> %s", f.color, color)
+	f.color = color
+	return f.rebuildClockDrawer()
+}
+
+func (f *fake) setImageType(raw interface{}) error {
+	imageType, ok := raw.(string)
+	if !ok {
+		return errors.New("set_image_type requires a string value")
+	}
+	if _, ok := imageTypes[imageType]; !ok {
+		return fmt.Errorf("config image_type %s invalid, valid image types: %s", imageType, strings.Join(imageTypeOptions, ", "))
+	}
+	f.logger.Infof("nickcam: image_type %s -> %s", f.imageType, imageType)
+	f.imageType = imageType
+	return f.rebuildClockDrawer()
+}
+
+func (f *fake) setBig(raw interface{}) error {
+	big, ok := raw.(bool)
+	if !ok {
+		return errors.New("set_big requires a bool value")
+	}
+	f.logger.Infof("nickcam: big %t -> %t", f.big, big)
+	f.big = big
+	return f.rebuildClockDrawer()
+}
+
+func (f *fake) rebuildClockDrawer() error {
+	cd, err := clockdrawer.New(f.Name().String(), colors[f.color], f.imageType, f.big)
+	if err != nil {
+		return err
+	}
+	f.clockDrawer = &cd
+	return nil
+}
+
+func (f *fake) configMap() map[string]interface{} {
+	return map[string]interface{}{
+		"big":        f.big,
+		"color":      f.color,
+		"image_type": f.imageType,
+	}
+}
+
+func (f *fake) getMP4Segment(ctx context.Context, raw interface{}) (map[string]interface{}, error) {
+	if f.rtsp == nil {
+		return nil, errors.New("get_mp4_segment requires source: rtsp")
+	}
+
+	args, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("get_mp4_segment requires a duration_sec argument")
+	}
+	durationSec, ok := args["duration_sec"].(float64)
+	if !ok || durationSec <= 0 {
+		return nil, errors.New("get_mp4_segment requires a positive duration_sec argument")
+	}
+
+	segment, err := f.rtsp.MP4Segment(ctx, time.Duration(durationSec*float64(time.Second)))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"mp4_base64": base64.StdEncoding.EncodeToString(segment),
+	}, nil
+}
+
+// maybeFault applies the latency/error/drop behavior injected for method, if
+// any. f.mu must already be held by the caller.
+func (f *fake) maybeFault(ctx context.Context, method string) error {
+	flt, ok := f.faults[method]
+	if !ok {
+		return nil
+	}
+	flt.calls++
+
+	if flt.LatencyMs > 0 {
+		f.mu.Unlock()
+		select {
+		case <-time.After(time.Duration(flt.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+		}
+		f.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	if flt.DropEveryN > 0 && flt.calls%flt.DropEveryN == 0 {
+		return data.ErrNoCaptureToStore
+	}
+
+	if flt.Probability > 0 && rand.Float64() < flt.Probability {
+		return faultError(flt.Error)
+	}
+
+	return nil
+}
+
+// checkFault is maybeFault for callers, like the gostream MediaStream
+// returned from Stream, that don't already hold f.mu.
+func (f *fake) checkFault(ctx context.Context, method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maybeFault(ctx, method)
+}
+
+func faultError(name string) error {
+	switch name {
+	case "deadline":
+		return context.DeadlineExceeded
+	case "":
+		return errors.New("nickcam: injected fault")
+	default:
+		return errors.New(name)
+	}
+}
+
+func (f *fake) injectFault(raw interface{}) error {
+	args, ok := raw.(map[string]interface{})
+	if !ok {
+		return errors.New("inject requires a method and fault parameters")
+	}
+	method, ok := args["method"].(string)
+	if !ok || method == "" {
+		return errors.New("inject requires a method")
+	}
+
+	flt := &fault{}
+	if errName, ok := args["error"].(string); ok {
+		flt.Error = errName
+	}
+	if probability, ok := args["probability"].(float64); ok {
+		flt.Probability = probability
+	}
+	if latencyMs, ok := args["latency_ms"].(float64); ok {
+		flt.LatencyMs = int(latencyMs)
+	}
+	if dropEveryN, ok := args["drop_every_n"].(float64); ok {
+		flt.DropEveryN = int(dropEveryN)
+	}
+	if corrupt, ok := args["corrupt"].(bool); ok {
+		flt.Corrupt = corrupt
+	}
+
+	if f.faults == nil {
+		f.faults = map[string]*fault{}
+	}
+	f.faults[method] = flt
+	f.logger.Infof("nickcam: injected fault on %s: %+v", method, flt)
+	return nil
+}
+
+func (f *fake) clearFault(raw interface{}) {
+	if method, ok := raw.(string); ok && method != "" {
+		delete(f.faults, method)
+		f.logger.Infof("nickcam: cleared fault on %s", method)
+		return
+	}
+	f.faults = map[string]*fault{}
+	f.logger.Infof("nickcam: cleared all faults")
+}
+
+func (f *fake) listFaults() map[string]interface{} {
+	out := map[string]interface{}{}
+	for method, flt := range f.faults {
+		out[method] = map[string]interface{}{
+			"error":        flt.Error,
+			"probability":  flt.Probability,
+			"latency_ms":   flt.LatencyMs,
+			"drop_every_n": flt.DropEveryN,
+			"corrupt":      flt.Corrupt,
+		}
+	}
+	return map[string]interface{}{"faults": out}
+}
+
+func (f *fake) Close(ctx context.Context) error {
+	if f.rtsp != nil {
+		return f.rtsp.Close()
+	}
+	return nil
+}
+
 func mainWithArgs(ctx context.Context, args []string, logger logging.Logger) (err error) {
 	resource.RegisterComponent(
 		camera.API,